@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// RenditionConfig describes one rung of the ABR ladder.
+type RenditionConfig struct {
+	Name             string `json:"name"`
+	Width            int    `json:"width"`
+	Height           int    `json:"height"`
+	VideoBitrateKbps int    `json:"video_bitrate_kbps"`
+	AudioBitrateKbps int    `json:"audio_bitrate_kbps"`
+	CQ               int    `json:"cq"`
+}
+
+// Config holds operator-tunable settings that aren't wired through the
+// simple env-only globals in init().
+type Config struct {
+	Renditions      []RenditionConfig `json:"renditions"`
+	OverlayTemplate string            `json:"overlay_template"`
+}
+
+var appConfig Config
+
+// defaultOverlayTemplate is the ffmpeg eval expression drawtext reloads from
+// overlay.txt every frame. %.2f/%.2f are filled in with the current
+// program's elapsed seconds and duration.
+const defaultOverlayTemplate = "%%{eif:100*(t+%.2f)/%.2f:d}%%"
+
+// defaultRenditions is the ladder used when no config.json is present and
+// RENDITIONS is unset.
+var defaultRenditions = []RenditionConfig{
+	{Name: "1080p", Width: 1920, Height: 1080, VideoBitrateKbps: 5000, AudioBitrateKbps: 192, CQ: 21},
+	{Name: "720p", Width: 1280, Height: 720, VideoBitrateKbps: 2800, AudioBitrateKbps: 128, CQ: 23},
+	{Name: "480p", Width: 854, Height: 480, VideoBitrateKbps: 1400, AudioBitrateKbps: 128, CQ: 25},
+	{Name: "360p", Width: 640, Height: 360, VideoBitrateKbps: 800, AudioBitrateKbps: 96, CQ: 28},
+}
+
+// loadConfig populates appConfig from config.json (CONFIG_PATH overrides the
+// filename) and falls back to defaultRenditions when nothing is found or the
+// ladder is empty. It mirrors loadGenesis's "load or create defaults" shape.
+func loadConfig() error {
+	path := "config.json"
+	if p := os.Getenv("CONFIG_PATH"); p != "" {
+		path = p
+	}
+
+	appConfig = Config{Renditions: defaultRenditions}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if r := os.Getenv("RENDITIONS"); r != "" {
+			if parsed, perr := parseRenditionsEnv(r); perr == nil && len(parsed) > 0 {
+				appConfig.Renditions = parsed
+			} else if perr != nil {
+				log.Printf("Ignoring malformed RENDITIONS env var: %v", perr)
+			}
+		}
+		log.Printf("No config.json found, using %d renditions from RENDITIONS or the defaults", len(appConfig.Renditions))
+		return nil
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return err
+	}
+	if len(cfg.Renditions) > 0 {
+		appConfig.Renditions = cfg.Renditions
+	}
+	appConfig.OverlayTemplate = cfg.OverlayTemplate
+	log.Printf("Loaded %d renditions from %s", len(appConfig.Renditions), path)
+	return nil
+}
+
+// parseRenditionsEnv accepts a compact "name:WxH:vbitrate:abitrate:cq,..."
+// list for environments where dropping a config.json isn't convenient.
+func parseRenditionsEnv(s string) ([]RenditionConfig, error) {
+	var out []RenditionConfig
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		fields := strings.Split(entry, ":")
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("expected name:WxH:vbitrate:abitrate:cq, got %q", entry)
+		}
+		dims := strings.Split(fields[1], "x")
+		if len(dims) != 2 {
+			return nil, fmt.Errorf("expected WxH, got %q", fields[1])
+		}
+		width, err := strconv.Atoi(dims[0])
+		if err != nil {
+			return nil, err
+		}
+		height, err := strconv.Atoi(dims[1])
+		if err != nil {
+			return nil, err
+		}
+		vbr, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, err
+		}
+		abr, err := strconv.Atoi(fields[3])
+		if err != nil {
+			return nil, err
+		}
+		cq, err := strconv.Atoi(fields[4])
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, RenditionConfig{
+			Name:             fields[0],
+			Width:            width,
+			Height:           height,
+			VideoBitrateKbps: vbr,
+			AudioBitrateKbps: abr,
+			CQ:               cq,
+		})
+	}
+	return out, nil
+}
+
+// buildRenditionFilterComplex splits the decoded video once and scales each
+// split to a rendition's target resolution, e.g.:
+//
+//	[0:v]split=3[r0][r1][r2];[r0]scale=1920:1080[v0];[r1]scale=1280:720[v1];...
+//
+// The resulting [vN] labels are reused by both the HLS and LLHLS output
+// groups so the scaling work only happens once per rendition.
+func buildRenditionFilterComplex(renditions []RenditionConfig) string {
+	var b strings.Builder
+
+	b.WriteString("[0:v]split=")
+	b.WriteString(strconv.Itoa(len(renditions)))
+	for i := range renditions {
+		fmt.Fprintf(&b, "[r%d]", i)
+	}
+
+	for i, r := range renditions {
+		fmt.Fprintf(&b, ";[r%d]scale=%d:%d[v%d]", i, r.Width, r.Height, i)
+	}
+
+	return b.String()
+}
+
+// buildRenditionOutputArgs emits the per-rendition encode + hls-muxer output
+// group (var_stream_map ABR ladder + master playlist) for one protocol
+// (HLS or LLHLS). segmentExt/hlsSegmentType select plain .ts vs fmp4 .m4s.
+func buildRenditionOutputArgs(renditions []RenditionConfig, outputDir string, segmentDuration int, startNumber int64, segmentExt string, hlsSegmentType string) []string {
+	var args []string
+
+	for i, r := range renditions {
+		args = append(args,
+			"-map", fmt.Sprintf("[v%d]", i),
+			"-map", "0:a",
+			fmt.Sprintf("-c:v:%d", i), "h264_nvenc",
+			fmt.Sprintf("-tune:v:%d", i), "ll",
+			fmt.Sprintf("-preset:v:%d", i), "fast",
+			fmt.Sprintf("-cq:v:%d", i), strconv.Itoa(r.CQ),
+			fmt.Sprintf("-b:v:%d", i), fmt.Sprintf("%dk", r.VideoBitrateKbps),
+			fmt.Sprintf("-c:a:%d", i), "aac",
+			fmt.Sprintf("-b:a:%d", i), fmt.Sprintf("%dk", r.AudioBitrateKbps),
+		)
+	}
+
+	varStreamMap := make([]string, len(renditions))
+	for i := range renditions {
+		varStreamMap[i] = fmt.Sprintf("v:%d,a:%d,name:%d", i, i, i)
+	}
+
+	args = append(args,
+		"-f", "hls",
+		"-hls_time", strconv.Itoa(segmentDuration),
+		"-hls_list_size", "10",
+		"-hls_flags", "delete_segments",
+		"-start_number", strconv.FormatInt(startNumber, 10),
+		"-var_stream_map", strings.Join(varStreamMap, " "),
+		"-master_pl_name", "master.m3u8",
+	)
+	if hlsSegmentType != "" {
+		args = append(args, "-hls_segment_type", hlsSegmentType)
+	}
+	// playlistBasename is the per-rendition HLS playlist ffmpeg itself
+	// writes and keeps rewriting every segment. For the LLHLS output group
+	// that name is "raw_*" rather than the real "stream_v%v.m3u8", because
+	// llhlsManager owns that filename - it reads the raw playlist's segment
+	// list, splits closed segments into parts, and atomically writes its own
+	// LL-HLS-tagged playlist at "stream_v%v.m3u8". Two writers on the same
+	// path would race, and whichever wrote last would silently drop the
+	// other's LL-HLS tags.
+	playlistBasename := "stream_v%v.m3u8"
+	if hlsSegmentType == "fmp4" {
+		args = append(args, "-hls_fmp4_init_filename", "init_v%v.mp4")
+		playlistBasename = "raw_stream_v%v.m3u8"
+	}
+	args = append(args,
+		"-hls_segment_filename", filepath.Join(outputDir, fmt.Sprintf("segment_v%%v_%%d.%s", segmentExt)),
+		filepath.Join(outputDir, playlistBasename),
+	)
+
+	return args
+}
+
+// rewriteMasterPlaylistURIs replaces one rendition-playlist basename with
+// another in a ffmpeg-generated master playlist's #EXT-X-STREAM-INF URI
+// lines - used to point LLHLS's master.m3u8 at the real "stream_v%v.m3u8"
+// playlists llhlsManager writes instead of ffmpeg's own "raw_stream_v%v.m3u8".
+func rewriteMasterPlaylistURIs(path, old, new string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(strings.ReplaceAll(string(data), old, new)), 0644)
+}
+
+// annotateMasterPlaylistCodecs rewrites a ffmpeg-generated master playlist to
+// add a CODECS attribute to each #EXT-X-STREAM-INF line, since the HLS muxer
+// doesn't emit one. Renditions must be given in the same order ffmpeg wrote
+// them (i.e. the order passed to -var_stream_map).
+func annotateMasterPlaylistCodecs(path string, renditions []RenditionConfig) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	const codecs = `CODECS="avc1.640028,mp4a.40.2"`
+	lines := strings.Split(string(data), "\n")
+	idx := 0
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "#EXT-X-STREAM-INF:") {
+			continue
+		}
+		if idx >= len(renditions) {
+			break
+		}
+		if !strings.Contains(line, "CODECS=") {
+			lines[i] = fmt.Sprintf("%s,%s", strings.TrimRight(line, "\r"), codecs)
+		}
+		idx++
+	}
+
+	return os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// EventType identifies a station lifecycle event published on the bus.
+type EventType string
+
+const (
+	EventViewerJoined   EventType = "viewer_joined"
+	EventViewerLeft     EventType = "viewer_left"
+	EventFFmpegStarted  EventType = "ffmpeg_started"
+	EventFFmpegExited   EventType = "ffmpeg_exited"
+	EventPaused         EventType = "paused"
+	EventResumed        EventType = "resumed"
+	EventSought         EventType = "sought"
+	EventProgramChanged EventType = "program_changed"
+	EventStreamStalled  EventType = "stream_stalled"
+)
+
+// Event is what gets published on the bus and streamed to /api/events.
+type Event struct {
+	Type EventType              `json:"type"`
+	Time int64                  `json:"time"`
+	Data map[string]interface{} `json:"data,omitempty"`
+}
+
+// broadcaster fans out published events to however many subscribers are
+// currently listening (dashboard tabs, mostly). Events a slow subscriber
+// has no buffer room for are dropped rather than allowed to block
+// publishers; the subscriber itself stays subscribed.
+type broadcaster struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+func newBroadcaster() *broadcaster {
+	return &broadcaster{subscribers: make(map[chan Event]struct{})}
+}
+
+func (b *broadcaster) Subscribe() (ch chan Event, cancel func()) {
+	ch = make(chan Event, 16)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		delete(b.subscribers, ch)
+		b.mu.Unlock()
+		close(ch)
+	}
+}
+
+func (b *broadcaster) Publish(t EventType, data map[string]interface{}) {
+	evt := Event{Type: t, Time: time.Now().Unix(), Data: data}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- evt:
+		default:
+			// Subscriber isn't keeping up; drop the event rather than block.
+		}
+	}
+}
+
+var eventBus = newBroadcaster()
+
+// handleEvents is a Server-Sent Events endpoint so the dashboard can push-
+// update instead of polling /api/stats every couple of seconds.
+func handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	ch, cancel := eventBus.Subscribe()
+	defer cancel()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case evt := <-ch:
+			data, err := json.Marshal(evt)
+			if err != nil {
+				continue
+			}
+			w.Write([]byte("data: "))
+			w.Write(data)
+			w.Write([]byte("\n\n"))
+			flusher.Flush()
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Native LL-HLS support.
+//
+// ffmpeg's own hls muxer doesn't emit #EXT-X-PART/#EXT-X-PRELOAD-HINT, so we
+// let it write whole fmp4 segments as before and then slice each closed
+// segment into a handful of independently-fetchable CMAF-ish part files
+// here, driving our own playlist with the real LL-HLS tags. This is the
+// same "approximated" spirit as the original single-second LLHLS output -
+// good enough for sub-second glass-to-glass in a browser, not a spec-exact
+// muxer.
+
+const (
+	llhlsPartTarget = 0.33 // seconds, #EXT-X-PART-INF:PART-TARGET
+	llhlsWindow     = 6    // segments kept in the playlist/on disk
+)
+
+type llhlsPart struct {
+	Name        string
+	Duration    float64
+	Independent bool
+}
+
+type llhlsSegment struct {
+	Seq      int64
+	Name     string
+	Duration float64
+	Parts    []llhlsPart
+}
+
+// llhlsRendition tracks one variant's closed segments.
+type llhlsRendition struct {
+	segments []llhlsSegment
+}
+
+// llhlsManager owns the part-splitting watchers and playlist state for one
+// ffmpeg run. It's recreated every time ffmpeg (re)starts.
+type llhlsManager struct {
+	mu         sync.Mutex
+	cond       *sync.Cond
+	outputDir  string
+	renditions map[string]*llhlsRendition
+	done       chan struct{}
+}
+
+func newLLHLSManager(outputDir string) *llhlsManager {
+	m := &llhlsManager{
+		outputDir:  outputDir,
+		renditions: make(map[string]*llhlsRendition),
+		done:       make(chan struct{}),
+	}
+	m.cond = sync.NewCond(&m.mu)
+	return m
+}
+
+// Start launches one watcher goroutine per rendition name ("0", "1", ...).
+func (m *llhlsManager) Start(names []string, startSeq int64, segmentDuration int) {
+	for _, name := range names {
+		m.mu.Lock()
+		m.renditions[name] = &llhlsRendition{}
+		m.mu.Unlock()
+		go m.watchRendition(name, startSeq, float64(segmentDuration))
+	}
+}
+
+// Stop halts all watchers for this run.
+func (m *llhlsManager) Stop() {
+	close(m.done)
+}
+
+func (m *llhlsManager) watchRendition(name string, seq int64, segmentDuration float64) {
+	for {
+		select {
+		case <-m.done:
+			return
+		default:
+		}
+
+		cur := filepath.Join(m.outputDir, fmt.Sprintf("segment_v%s_%d.m4s", name, seq))
+		next := filepath.Join(m.outputDir, fmt.Sprintf("segment_v%s_%d.m4s", name, seq+1))
+
+		_, curErr := os.Stat(cur)
+		_, nextErr := os.Stat(next)
+		if curErr != nil || nextErr != nil {
+			time.Sleep(50 * time.Millisecond)
+			continue
+		}
+
+		seg, err := m.splitSegment(name, seq, cur, segmentDuration)
+		if err != nil {
+			log.Printf("LLHLS: failed to split segment %s: %v", cur, err)
+			seq++
+			continue
+		}
+
+		m.publish(name, seg)
+		seq++
+	}
+}
+
+// splitSegment cuts a closed fmp4 segment into llhlsPartTarget-sized parts
+// via stream-copy, which is cheap since no re-encode is involved.
+func (m *llhlsManager) splitSegment(name string, seq int64, path string, segmentDuration float64) (llhlsSegment, error) {
+	nParts := int(segmentDuration/llhlsPartTarget + 0.5)
+	if nParts < 1 {
+		nParts = 1
+	}
+	partDuration := segmentDuration / float64(nParts)
+
+	pattern := filepath.Join(m.outputDir, fmt.Sprintf("segment_v%s_%d.part%%02d.m4s", name, seq))
+	cmd := exec.Command("ffmpeg",
+		"-v", "error", "-y",
+		"-i", path,
+		"-c", "copy",
+		"-f", "segment",
+		"-segment_time", fmt.Sprintf("%.3f", partDuration),
+		"-reset_timestamps", "0",
+		pattern,
+	)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return llhlsSegment{}, fmt.Errorf("%v: %s", err, stderr.String())
+	}
+
+	partFiles, _ := filepath.Glob(filepath.Join(m.outputDir, fmt.Sprintf("segment_v%s_%d.part*.m4s", name, seq)))
+	sort.Strings(partFiles)
+
+	seg := llhlsSegment{
+		Seq:      seq,
+		Name:     filepath.Base(path),
+		Duration: segmentDuration,
+	}
+	for i, pf := range partFiles {
+		seg.Parts = append(seg.Parts, llhlsPart{
+			Name:        filepath.Base(pf),
+			Duration:    partDuration,
+			Independent: i == 0,
+		})
+	}
+	return seg, nil
+}
+
+// publish appends a newly-split segment to the window, evicts anything that
+// falls out of it, rewrites the playlist and wakes blocked reloaders.
+func (m *llhlsManager) publish(name string, seg llhlsSegment) {
+	m.mu.Lock()
+	r, ok := m.renditions[name]
+	if !ok {
+		m.mu.Unlock()
+		return
+	}
+	r.segments = append(r.segments, seg)
+
+	var evicted []llhlsSegment
+	for len(r.segments) > llhlsWindow {
+		evicted = append(evicted, r.segments[0])
+		r.segments = r.segments[1:]
+	}
+	segments := append([]llhlsSegment(nil), r.segments...)
+	m.mu.Unlock()
+
+	for _, old := range evicted {
+		for _, p := range old.Parts {
+			os.Remove(filepath.Join(m.outputDir, p.Name))
+		}
+	}
+
+	if err := m.writePlaylist(name, segments); err != nil {
+		log.Printf("LLHLS: failed to write playlist for rendition %s: %v", name, err)
+	}
+
+	m.mu.Lock()
+	m.cond.Broadcast()
+	m.mu.Unlock()
+}
+
+func (m *llhlsManager) writePlaylist(name string, segments []llhlsSegment) error {
+	if len(segments) == 0 {
+		return nil
+	}
+
+	targetDuration := 1
+	for _, s := range segments {
+		if d := int(s.Duration + 0.999); d > targetDuration {
+			targetDuration = d
+		}
+	}
+	holdBack := 3 * llhlsPartTarget
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "#EXTM3U\n")
+	fmt.Fprintf(&b, "#EXT-X-VERSION:9\n")
+	fmt.Fprintf(&b, "#EXT-X-TARGETDURATION:%d\n", targetDuration)
+	fmt.Fprintf(&b, "#EXT-X-PART-INF:PART-TARGET=%.3f\n", llhlsPartTarget)
+	fmt.Fprintf(&b, "#EXT-X-SERVER-CONTROL:CAN-BLOCK-RELOAD=YES,PART-HOLD-BACK=%.3f\n", holdBack)
+	fmt.Fprintf(&b, "#EXT-X-MEDIA-SEQUENCE:%d\n", segments[0].Seq)
+	fmt.Fprintf(&b, "#EXT-X-MAP:URI=\"init_v%s.mp4\"\n", name)
+
+	for _, s := range segments {
+		for _, p := range s.Parts {
+			independent := ""
+			if p.Independent {
+				independent = ",INDEPENDENT=YES"
+			}
+			fmt.Fprintf(&b, "#EXT-X-PART:DURATION=%.3f,URI=\"%s\"%s\n", p.Duration, p.Name, independent)
+		}
+		fmt.Fprintf(&b, "#EXTINF:%.3f,\n%s\n", s.Duration, s.Name)
+	}
+
+	// Hint at the next part about to be produced. We only learn about parts
+	// once a whole segment has closed, so this points at the first part of
+	// the next segment rather than a still-filling one - an approximation
+	// of the spec's "mid-segment" preload hint, but it still lets a client
+	// open the request early and block until the part exists.
+	last := segments[len(segments)-1]
+	nextSeq := last.Seq + 1
+	fmt.Fprintf(&b, "#EXT-X-PRELOAD-HINT:TYPE=PART,URI=\"segment_v%s_%d.part00.m4s\"\n", name, nextSeq)
+
+	tmp := filepath.Join(m.outputDir, fmt.Sprintf("stream_v%s.m3u8.tmp", name))
+	final := filepath.Join(m.outputDir, fmt.Sprintf("stream_v%s.m3u8", name))
+	if err := os.WriteFile(tmp, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, final)
+}
+
+// lastSeq returns the most recent published segment sequence for a
+// rendition, or -1 if none has been published yet.
+func (m *llhlsManager) lastSeq(name string) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.renditions[name]
+	if !ok || len(r.segments) == 0 {
+		return -1
+	}
+	return r.segments[len(r.segments)-1].Seq
+}
+
+// lastPartCount returns how many parts the most recent segment has.
+func (m *llhlsManager) lastPartCount(name string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	r, ok := m.renditions[name]
+	if !ok || len(r.segments) == 0 {
+		return 0
+	}
+	return len(r.segments[len(r.segments)-1].Parts)
+}
+
+// awaitMediaSequence blocks until segment msn (and, if part >= 0, that part
+// within it) is available, or the timeout elapses - the CAN-BLOCK-RELOAD
+// semantics _HLS_msn/_HLS_part rely on.
+func (m *llhlsManager) awaitMediaSequence(name string, msn int64, part int, timeout time.Duration) {
+	deadline := time.Now().Add(timeout)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for {
+		r, ok := m.renditions[name]
+		if ok {
+			last := int64(-1)
+			if len(r.segments) > 0 {
+				last = r.segments[len(r.segments)-1].Seq
+			}
+			if last > msn {
+				return
+			}
+			if last == msn {
+				if part < 0 {
+					return
+				}
+				if len(r.segments[len(r.segments)-1].Parts) > part {
+					return
+				}
+			}
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return
+		}
+		if remaining > 200*time.Millisecond {
+			remaining = 200 * time.Millisecond
+		}
+		t := time.AfterFunc(remaining, func() {
+			m.mu.Lock()
+			m.cond.Broadcast()
+			m.mu.Unlock()
+		})
+		m.cond.Wait()
+		t.Stop()
+	}
+}
+
+// renditionNameFromPlaylist extracts "0" from "stream_v0.m3u8".
+func renditionNameFromPlaylist(filename string) (string, bool) {
+	if !strings.HasPrefix(filename, "stream_v") || !strings.HasSuffix(filename, ".m3u8") {
+		return "", false
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(filename, "stream_v"), ".m3u8"), true
+}
+
+// parseBlockingReloadParams reads _HLS_msn/_HLS_part off a request's query
+// string per the LL-HLS spec (part without msn is invalid and ignored).
+func parseBlockingReloadParams(msnStr, partStr string) (msn int64, part int, ok bool) {
+	if msnStr == "" {
+		return 0, 0, false
+	}
+	var err error
+	msn, err = strconv.ParseInt(msnStr, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	part = -1
+	if partStr != "" {
+		part, err = strconv.Atoi(partStr)
+		if err != nil {
+			part = -1
+		}
+	}
+	return msn, part, true
+}
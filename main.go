@@ -1,8 +1,8 @@
 package main
 
 import (
-	_ "embed"
 	"context"
+	_ "embed"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -15,11 +15,13 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 )
 
 // Embed the dashboard HTML
+//
 //go:embed dashboard.html
 var dashboardHTML string
 
@@ -27,13 +29,20 @@ var dashboardHTML string
 var (
 	DefaultPort          = 8093
 	LLHLSPort            = 3333
+	RTMPListenPort       = 1935
 	VideoPath            = "video.mp4"
+	MediaDir             = "."
 	OutputDirHLS         = "./stream/hls"
 	OutputDirLLHLS       = "./stream/llhls"
 	SegmentDurationHLS   = 4
 	SegmentDurationLLHLS = 1
 	IdleTimeout          = 30 * time.Second
 	StatsUpdatePeriod    = 2 * time.Second
+
+	// AllowedSourceHosts gates /api/source's rtsp/srt/hls URLs: empty means
+	// none are permitted, since those sources make the station fetch from
+	// wherever the caller points it.
+	AllowedSourceHosts []string
 )
 
 // Genesis represents the station's start time and state
@@ -45,22 +54,37 @@ type Genesis struct {
 
 // StreamManager handles the virtual live logic
 type StreamManager struct {
-	genesis        *Genesis
-	videoDuration  float64
-	ffmpegCmd      *exec.Cmd
-	ffmpegMutex    sync.Mutex
-	lastAccess     time.Time
-	isRunning      bool
-	
+	genesis       *Genesis
+	videoDuration float64
+	ffmpegCmd     *exec.Cmd
+	ffmpegExited  chan struct{} // closed once ffmpegCmd.Wait() returns
+	ffmpegMutex   sync.Mutex
+	lastAccess    time.Time
+	isRunning     bool
+
 	// Viewer tracking
-	viewersHLS     map[string]time.Time
-	viewersLLHLS   map[string]time.Time
-	viewersMutex   sync.Mutex
+	viewersHLS   map[string]time.Time
+	viewersLLHLS map[string]time.Time
+	viewersMutex sync.Mutex
 
 	// CPU tracking
 	prevIdleTime   uint64
 	prevTotalTime  uint64
 	cachedCPUUsage string
+
+	// Scheduled playback
+	currentProgram Program
+	nextProgram    *Program
+
+	// Native LL-HLS part splitting, recreated on every ffmpeg (re)start
+	llhlsMgr *llhlsManager
+
+	hasStartedOnce bool
+
+	// Input source. File is the only seekable one - everything else is a
+	// live ingest run in virtual-live passthrough (no pause/seek/schedule).
+	source      Source
+	sourceMutex sync.Mutex
 }
 
 // Stats response for the dashboard
@@ -75,6 +99,9 @@ type Stats struct {
 	CPUUsage       string   `json:"cpu_usage"` // Placeholder
 	Progress       float64  `json:"progress"`
 	VideoDuration  float64  `json:"video_duration"`
+	CurrentProgram string   `json:"current_program"`
+	NextProgram    string   `json:"next_program"`
+	Source         string   `json:"source"`
 }
 
 var streamManager *StreamManager
@@ -91,9 +118,24 @@ func init() {
 			LLHLSPort = i
 		}
 	}
+	if p := os.Getenv("RTMP_LISTEN_PORT"); p != "" {
+		if i, err := strconv.Atoi(p); err == nil {
+			RTMPListenPort = i
+		}
+	}
 	if v := os.Getenv("VIDEO_PATH"); v != "" {
 		VideoPath = v
 	}
+	if d := os.Getenv("MEDIA_DIR"); d != "" {
+		MediaDir = d
+	}
+	if h := os.Getenv("ALLOWED_SOURCE_HOSTS"); h != "" {
+		for _, host := range strings.Split(h, ",") {
+			if host = strings.TrimSpace(host); host != "" {
+				AllowedSourceHosts = append(AllowedSourceHosts, host)
+			}
+		}
+	}
 }
 
 func main() {
@@ -107,6 +149,15 @@ func main() {
 		lastAccess:   time.Now(),
 	}
 
+	if err := loadConfig(); err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+
+	scheduler = newScheduler("schedule.json")
+	if err := scheduler.load(); err != nil {
+		log.Fatalf("Failed to load schedule: %v", err)
+	}
+
 	if err := streamManager.loadGenesis(); err != nil {
 		log.Fatalf("Failed to load genesis: %v", err)
 	}
@@ -115,11 +166,20 @@ func main() {
 		log.Fatalf("Failed to get video duration: %v", err)
 	}
 
+	src, err := newSource(os.Getenv("SOURCE_TYPE"), os.Getenv("SOURCE_URL"))
+	if err != nil {
+		log.Printf("Ignoring invalid SOURCE_TYPE/SOURCE_URL (%v), falling back to file source", err)
+		src, _ = newSource("file", "")
+	}
+	streamManager.source = src
+
 	// Start background tasks
 	go streamManager.watchdog()
 	go streamManager.monitorStreamHealth()
 	go streamManager.cleanupViewers()
 	go streamManager.updateCPUStats()
+	go streamManager.watchProgramBoundary()
+	go watchConfigFiles(streamManager)
 
 	// HLS Server
 	muxHLS := http.NewServeMux()
@@ -127,6 +187,10 @@ func main() {
 	muxHLS.Handle("/hls/", http.StripPrefix("/hls", corsMiddleware(createStreamHandler(OutputDirHLS, "video/MP2T", "stream.m3u8", "hls"))))
 	muxHLS.HandleFunc("/api/stats", corsMiddleware(http.HandlerFunc(handleStats)))
 	muxHLS.HandleFunc("/api/control", corsMiddleware(http.HandlerFunc(handleControl)))
+	muxHLS.HandleFunc("/api/schedule", corsMiddleware(http.HandlerFunc(handleSchedule)))
+	muxHLS.HandleFunc("/api/source", corsMiddleware(http.HandlerFunc(handleSource)))
+	muxHLS.HandleFunc("/metrics", handleMetrics)
+	muxHLS.HandleFunc("/api/events", corsMiddleware(http.HandlerFunc(handleEvents)))
 
 	serverHLS := &http.Server{
 		Addr:    fmt.Sprintf(":%d", DefaultPort),
@@ -195,7 +259,7 @@ func handleDashboard(w http.ResponseWriter, r *http.Request) {
 func handleStats(w http.ResponseWriter, r *http.Request) {
 	viewersHLS, viewersLLHLS := streamManager.getViewerStats()
 	total := len(viewersHLS) + len(viewersLLHLS)
-	
+
 	status := "Idle"
 	if streamManager.genesis.IsPaused {
 		status = "Paused"
@@ -214,6 +278,9 @@ func handleStats(w http.ResponseWriter, r *http.Request) {
 		CPUUsage:       streamManager.getCachedCPU(),
 		Progress:       streamManager.getProgress(),
 		VideoDuration:  streamManager.videoDuration,
+		CurrentProgram: streamManager.currentProgram.Title,
+		NextProgram:    streamManager.nextProgramTitle(),
+		Source:         streamManager.sourceDescription(),
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -227,10 +294,13 @@ func handleControl(w http.ResponseWriter, r *http.Request) {
 	}
 
 	action := r.URL.Query().Get("action")
-	
+
 	switch action {
 	case "pause":
-		streamManager.pauseStream()
+		if err := streamManager.pauseStream(); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
 	case "resume":
 		streamManager.resumeStream()
 	case "seek":
@@ -240,17 +310,129 @@ func handleControl(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Invalid position", http.StatusBadRequest)
 			return
 		}
-		streamManager.seekStream(pos)
+		if err := streamManager.seekStream(pos); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
 	default:
 		http.Error(w, "Invalid action", http.StatusBadRequest)
 		return
 	}
-	
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleSchedule is the EPG API: GET lists the day's schedule, POST
+// add/remove/reorder edits it. Edits don't touch ffmpeg directly -
+// watchProgramBoundary picks them up on its next tick and restarts ffmpeg
+// if the program that should be airing now differs from the one on air.
+func handleSchedule(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(scheduler.List())
+		return
+	case http.MethodPost:
+		// fall through
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	action := r.URL.Query().Get("action")
+	switch action {
+	case "add":
+		var entry ScheduleEntry
+		if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+			http.Error(w, "Invalid program", http.StatusBadRequest)
+			return
+		}
+		if _, err := parseTimeOfDay(entry.StartTime); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := scheduler.Add(entry); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	case "remove":
+		startTime := r.URL.Query().Get("start_time")
+		if startTime == "" {
+			http.Error(w, "Missing start_time", http.StatusBadRequest)
+			return
+		}
+		if err := scheduler.Remove(startTime); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	case "reorder":
+		var entries []ScheduleEntry
+		if err := json.NewDecoder(r.Body).Decode(&entries); err != nil {
+			http.Error(w, "Invalid schedule", http.StatusBadRequest)
+			return
+		}
+		for _, entry := range entries {
+			if _, err := parseTimeOfDay(entry.StartTime); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		if err := scheduler.Reorder(entries); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "Invalid action", http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleSource is the runtime input switch: GET reports what's live, POST
+// swaps in a new source (type + url) and restarts ffmpeg onto it. Switching
+// to or from a non-file source changes whether pause/seek/schedule apply.
+func handleSource(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		name, desc, seekable := streamManager.sourceInfo()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"type":     name,
+			"url":      desc,
+			"seekable": seekable,
+		})
+		return
+	case http.MethodPost:
+		// fall through
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var body struct {
+		Type string `json:"type"`
+		URL  string `json:"url"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Invalid source", http.StatusBadRequest)
+		return
+	}
+
+	src, err := newSource(body.Type, body.URL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	streamManager.switchSource(src)
 	w.WriteHeader(http.StatusOK)
 }
 
 func createStreamHandler(outputDir string, contentType string, playlistAlias string, streamType string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		requestStart := time.Now()
+
 		path := r.URL.Path
 		name := strings.TrimPrefix(path, "/")
 		if name == "" {
@@ -258,9 +440,21 @@ func createStreamHandler(outputDir string, contentType string, playlistAlias str
 			return
 		}
 
-		// Handle playlist alias
+		counted := &bytesCountingResponseWriter{ResponseWriter: w}
+		w = counted
+		defer func() {
+			metricsSegmentDuration.Observe(time.Since(requestStart).Seconds())
+			rendition := renditionLabelFromFilename(name)
+			metricsSegmentBytes.Add(fmt.Sprintf(`protocol="%s",rendition="%s"`, streamType, rendition), uint64(counted.bytesWritten))
+			if strings.HasSuffix(name, ".m3u8") {
+				metricsPlaylistReloads.Add(fmt.Sprintf(`protocol="%s"`, streamType), 1)
+			}
+		}()
+
+		// Handle playlist alias - points at the ABR master playlist, which
+		// fans out to the per-rendition sub-playlists ffmpeg produces.
 		if name == playlistAlias {
-			name = "stream.m3u8"
+			name = "master.m3u8"
 		}
 
 		// Track viewer
@@ -271,7 +465,7 @@ func createStreamHandler(outputDir string, contentType string, playlistAlias str
 		if strings.Contains(ip, ",") {
 			ip = strings.TrimSpace(strings.Split(ip, ",")[0])
 		}
-		
+
 		streamManager.trackViewer(ip, streamType)
 
 		// Start FFmpeg if not running and NOT PAUSED
@@ -288,6 +482,19 @@ func createStreamHandler(outputDir string, contentType string, playlistAlias str
 			streamManager.updateLastAccess()
 		}
 
+		// LL-HLS blocking playlist reload: a player long-polls a specific
+		// media sequence/part via _HLS_msn/_HLS_part and we hold the
+		// response until it's muxed or an 8-second timeout elapses.
+		if streamType == "llhls" {
+			if rendition, isRenditionPlaylist := renditionNameFromPlaylist(name); isRenditionPlaylist {
+				if msn, part, ok := parseBlockingReloadParams(r.URL.Query().Get("_HLS_msn"), r.URL.Query().Get("_HLS_part")); ok {
+					if mgr := streamManager.llhlsMgr; mgr != nil {
+						mgr.awaitMediaSequence(rendition, msn, part, 8*time.Second)
+					}
+				}
+			}
+		}
+
 		filePath := filepath.Join(outputDir, name)
 
 		// Wait loop for file existence
@@ -313,7 +520,7 @@ func createStreamHandler(outputDir string, contentType string, playlistAlias str
 		} else {
 			w.Header().Set("Content-Type", contentType)
 		}
-		
+
 		w.Header().Set("Cache-Control", "no-cache")
 		http.ServeFile(w, r, filePath)
 	}
@@ -350,157 +557,251 @@ func (sm *StreamManager) getVideoDuration() error {
 		"-show_entries", "format=duration",
 		"-of", "default=noprint_wrappers=1:nokey=1",
 		VideoPath)
-	
+
 	output, err := cmd.Output()
 	if err != nil {
 		return fmt.Errorf("failed to get video duration: %v", err)
 	}
-	
+
 	duration, err := strconv.ParseFloat(strings.TrimSpace(string(output)), 64)
 	if err != nil {
 		return fmt.Errorf("failed to parse duration: %v", err)
 	}
-	
+
 	sm.videoDuration = duration
 	log.Printf("Video duration: %.2f seconds", sm.videoDuration)
 	return nil
 }
 
-func (sm *StreamManager) calculateCurrentPosition() (seekTime float64, startNumberHLS, startNumberLLHLS int64) {
-	// If paused, use the paused position
+// elapsedSinceGenesis returns the virtual broadcast clock: seconds since the
+// station's genesis time, frozen at PausedPosition while paused.
+func (sm *StreamManager) elapsedSinceGenesis() float64 {
 	if sm.genesis.IsPaused {
-		seekTime = sm.genesis.PausedPosition
-	} else {
-		now := time.Now().Unix()
-		elapsed := float64(now - sm.genesis.StartTime)
-		
-		// Calculate position in loop
-		seekTime = elapsed
-		for seekTime >= sm.videoDuration {
-			seekTime -= sm.videoDuration
-		}
-	}
-	
-	// Calculate monotonic start numbers
-	// For HLS monotonic, we use elapsed time even if looped/seeked?
-	// If we seek, we might break continuity for existing players.
-	// Ideally, start number increments.
-	// For now, we derive from seekTime (which resets on loop).
-	// This might cause player glitch on loop, but fine for seeking.
-	// Better: use wall clock for monotonicity if possible, but content changes.
-	// We'll use seekTime logic for simplicity.
-	
-	startNumberHLS = int64(seekTime / float64(SegmentDurationHLS))
-	startNumberLLHLS = int64(seekTime / float64(SegmentDurationLLHLS))
-	
+		return sm.genesis.PausedPosition
+	}
+	return float64(time.Now().Unix() - sm.genesis.StartTime)
+}
+
+// resolveProgram maps `elapsed` onto either the schedule (if one has any
+// entries) or the legacy single-video loop, returning the program that
+// should be airing, how far into it we are, and what airs next.
+func (sm *StreamManager) resolveProgram(elapsed float64) (prog Program, offset float64, isBumper bool, next *Program) {
+	if scheduler != nil && len(scheduler.List().Entries) > 0 {
+		return scheduler.Resolve(elapsed)
+	}
+
+	seekTime := elapsed
+	for sm.videoDuration > 0 && seekTime >= sm.videoDuration {
+		seekTime -= sm.videoDuration
+	}
+	return Program{File: VideoPath, Duration: sm.videoDuration}, seekTime, false, nil
+}
+
+func (sm *StreamManager) calculateCurrentPosition() (seekTime float64, startNumberHLS, startNumberLLHLS int64) {
+	elapsed := sm.elapsedSinceGenesis()
+	_, seekTime, _, _ = sm.resolveProgram(elapsed)
+
+	// Segment numbers are derived from the raw broadcast-clock elapsed time
+	// rather than the (possibly looped/program-relative) seekTime, so they
+	// keep counting up across a video loop or a scheduler program change
+	// instead of resetting - see the scheduler's chaining requirement.
+	startNumberHLS = int64(elapsed / float64(SegmentDurationHLS))
+	startNumberLLHLS = int64(elapsed / float64(SegmentDurationLLHLS))
+
 	return
 }
 
+// refreshOverlay (re)writes overlay.txt from the current position and the
+// configured template. drawtext watches it with textfile=...:reload=1, so
+// this is also how a hot-reloaded overlay_template takes effect without an
+// ffmpeg restart.
+func (sm *StreamManager) refreshOverlay() {
+	prog, offset, _, _ := sm.resolveProgram(sm.elapsedSinceGenesis())
+	duration := prog.Duration
+	if duration <= 0 {
+		duration = sm.videoDuration
+	}
+
+	template := appConfig.OverlayTemplate
+	if template == "" {
+		template = defaultOverlayTemplate
+	}
+
+	os.WriteFile("overlay.txt", []byte(fmt.Sprintf(template, offset, duration)), 0644)
+}
+
 func (sm *StreamManager) startFFmpeg() error {
 	sm.ffmpegMutex.Lock()
 	defer sm.ffmpegMutex.Unlock()
-	
+
 	if sm.isRunning {
 		return nil
 	}
-	
-	seekTime, startNumberHLS, startNumberLLHLS := sm.calculateCurrentPosition()
-	
-	log.Printf("Starting FFmpeg at seek: %.2f, HLS segment: %d, LLHLS segment: %d", seekTime, startNumberHLS, startNumberLLHLS)
-	
-	// Clean up old segments
+
+	sm.sourceMutex.Lock()
+	source := sm.source
+	sm.sourceMutex.Unlock()
+	if source == nil {
+		source = &FileSource{Path: VideoPath}
+	}
+
+	var inputArgs []string
+	var startNumberHLS, startNumberLLHLS int64
+	overlay := false
+
+	if source.Seekable() {
+		elapsed := sm.elapsedSinceGenesis()
+		prog, offset, isBumper, next := sm.resolveProgram(elapsed)
+		sm.currentProgram = prog
+		sm.nextProgram = next
+
+		inputFile := prog.File
+		if inputFile == "" {
+			log.Printf("Warning: no bumper_file configured, falling back to %s", VideoPath)
+			inputFile = VideoPath
+		}
+		seekTime := prog.StartOffset + offset
+		startNumberHLS = int64(elapsed / float64(SegmentDurationHLS))
+		startNumberLLHLS = int64(elapsed / float64(SegmentDurationLLHLS))
+
+		log.Printf("Starting FFmpeg on %q (bumper=%v) at seek: %.2f, HLS segment: %d, LLHLS segment: %d", inputFile, isBumper, seekTime, startNumberHLS, startNumberLLHLS)
+
+		inputArgs = (&FileSource{Path: inputFile}).FFmpegInputArgs(seekTime)
+		overlay = true
+	} else {
+		// Virtual live passthrough: no seeking, no looping, no schedule - the
+		// source's own timeline is the only clock that matters. Segment
+		// numbers just start fresh since there's no broadcast clock to
+		// derive them from across restarts.
+		sm.currentProgram = Program{Title: fmt.Sprintf("Live (%s)", source.Name())}
+		sm.nextProgram = nil
+
+		log.Printf("Starting FFmpeg on live %s source %q", source.Name(), source.Describe())
+
+		inputArgs = source.FFmpegInputArgs(0)
+	}
+
+	// Clean up old segments and playlists from the previous run
 	files, _ := filepath.Glob(filepath.Join(OutputDirHLS, "*.ts"))
-	for _, f := range files { os.Remove(f) }
+	for _, f := range files {
+		os.Remove(f)
+	}
+	files, _ = filepath.Glob(filepath.Join(OutputDirHLS, "stream_v*.m3u8"))
+	for _, f := range files {
+		os.Remove(f)
+	}
+	os.Remove(filepath.Join(OutputDirHLS, "master.m3u8"))
 	files, _ = filepath.Glob(filepath.Join(OutputDirLLHLS, "*.m4s"))
-	for _, f := range files { os.Remove(f) }
+	for _, f := range files {
+		os.Remove(f)
+	}
 	files, _ = filepath.Glob(filepath.Join(OutputDirLLHLS, "*.mp4"))
-	for _, f := range files { os.Remove(f) }
-
-	// Write overlay text file to avoid command line escaping issues
-	overlayContent := fmt.Sprintf("%%{eif:100*(t+%.2f)/%.2f:d}%%", seekTime, sm.videoDuration)
-	os.WriteFile("overlay.txt", []byte(overlayContent), 0644)
-
-	vf := "drawtext=fontfile=/usr/share/fonts/truetype/dejavu/DejaVuSans-Bold.ttf:textfile=overlay.txt:reload=1:x=w-tw-10:y=h-th-10:fontsize=48:fontcolor=green:box=1:boxcolor=black@0.5"
-	log.Printf("FFmpeg Filter: %s", vf)
-
-	args := []string{
-		"-re",
-		"-ss", fmt.Sprintf("%.2f", seekTime),
-		"-i", VideoPath,
-		"-vf", vf,
-		"-c:v", "h264_nvenc",
-		"-tune", "ll",
-		"-preset", "fast",
-		"-cq", "26",
-		"-c:a", "copy",
-		
-		// Output 1: HLS (Standard)
-		"-f", "hls",
-		"-hls_time", fmt.Sprintf("%d", SegmentDurationHLS),
-		"-hls_list_size", "5",
-		"-hls_flags", "delete_segments",
-		"-start_number", fmt.Sprintf("%d", startNumberHLS),
-		"-hls_segment_filename", filepath.Join(OutputDirHLS, "segment%d.ts"),
-		filepath.Join(OutputDirHLS, "stream.m3u8"),
-
-		// Output 2: LLHLS (Low Latency - approximated)
-		"-c:v", "h264_nvenc",
-		"-tune", "ll",
-		"-preset", "fast",
-		"-cq", "26",
-		"-c:a", "copy",
-		"-f", "hls",
-		"-hls_time", fmt.Sprintf("%d", SegmentDurationLLHLS),
-		"-hls_list_size", "10", 
-		"-hls_flags", "delete_segments",
-		"-hls_segment_type", "fmp4",
-		"-start_number", fmt.Sprintf("%d", startNumberLLHLS),
-		"-hls_segment_filename", filepath.Join(OutputDirLLHLS, "segment%d.m4s"),
-		filepath.Join(OutputDirLLHLS, "stream.m3u8"),
-	}
-	
+	for _, f := range files {
+		os.Remove(f)
+	}
+	files, _ = filepath.Glob(filepath.Join(OutputDirLLHLS, "stream_v*.m3u8"))
+	for _, f := range files {
+		os.Remove(f)
+	}
+	files, _ = filepath.Glob(filepath.Join(OutputDirLLHLS, "raw_stream_v*.m3u8"))
+	for _, f := range files {
+		os.Remove(f)
+	}
+	os.Remove(filepath.Join(OutputDirLLHLS, "master.m3u8"))
+
+	renditions := appConfig.Renditions
+	if len(renditions) == 0 {
+		renditions = defaultRenditions
+	}
+
+	args := append([]string{}, inputArgs...)
+	filterComplex := buildRenditionFilterComplex(renditions)
+	if overlay {
+		sm.refreshOverlay()
+		vf := "drawtext=fontfile=/usr/share/fonts/truetype/dejavu/DejaVuSans-Bold.ttf:textfile=overlay.txt:reload=1:x=w-tw-10:y=h-th-10:fontsize=48:fontcolor=green:box=1:boxcolor=black@0.5"
+		log.Printf("FFmpeg Filter: %s", vf)
+		// Outputs fed from -filter_complex can't also take -vf, so drawtext
+		// runs in the filter graph itself, ahead of the rendition split.
+		filterComplex = strings.Replace(filterComplex, "[0:v]", "[0:v]"+vf+",", 1)
+	}
+	args = append(args, "-filter_complex", filterComplex)
+	args = append(args, buildRenditionOutputArgs(renditions, OutputDirHLS, SegmentDurationHLS, startNumberHLS, "ts", "")...)
+	args = append(args, buildRenditionOutputArgs(renditions, OutputDirLLHLS, SegmentDurationLLHLS, startNumberLLHLS, "m4s", "fmp4")...)
+
 	sm.ffmpegCmd = exec.Command("ffmpeg", args...)
 	sm.ffmpegCmd.Stdout = os.Stdout
 	sm.ffmpegCmd.Stderr = os.Stderr
-	
+
 	if err := sm.ffmpegCmd.Start(); err != nil {
 		log.Fatalf("Failed to start FFmpeg (fatal error, crashing to trigger restart): %v", err)
 		return fmt.Errorf("failed to start FFmpeg: %v", err)
 	}
-	
+
+	exited := make(chan struct{})
+	sm.ffmpegExited = exited
+
 	// Reaper
 	go func() {
 		err := sm.ffmpegCmd.Wait()
-		
+		close(exited)
+
 		sm.ffmpegMutex.Lock()
 		shouldBeRunning := sm.isRunning
 		sm.ffmpegMutex.Unlock()
-		
+
 		if shouldBeRunning && err != nil {
+			eventBus.Publish(EventFFmpegExited, map[string]interface{}{"error": err.Error()})
 			log.Fatalf("FFmpeg exited unexpectedly while stream should be running: %v. Crashing to trigger restart.", err)
 		} else if shouldBeRunning {
+			eventBus.Publish(EventFFmpegExited, map[string]interface{}{"error": "exited cleanly but unexpectedly"})
 			log.Printf("FFmpeg exited cleanly but unexpectedly. Crashing to trigger restart.")
 			os.Exit(1)
 		}
 	}()
-	
+
+	if sm.hasStartedOnce {
+		atomic.AddUint64(&metricsFFmpegRestarts, 1)
+	}
+	sm.hasStartedOnce = true
+
 	sm.isRunning = true
 	sm.lastAccess = time.Now()
-	
-	// Wait for playlist
+
+	// Wait for the master playlist
 	playlistCreated := false
 	for i := 0; i < 20; i++ {
-		if _, err := os.Stat(filepath.Join(OutputDirHLS, "stream.m3u8")); err == nil {
+		if _, err := os.Stat(filepath.Join(OutputDirHLS, "master.m3u8")); err == nil {
 			playlistCreated = true
 			break
 		}
 		time.Sleep(250 * time.Millisecond)
 	}
-	
+
 	if !playlistCreated {
 		return fmt.Errorf("timeout waiting for playlist creation")
 	}
-	
+
+	if err := annotateMasterPlaylistCodecs(filepath.Join(OutputDirHLS, "master.m3u8"), renditions); err != nil {
+		log.Printf("Warning: failed to annotate HLS master playlist with codecs: %v", err)
+	}
+	if err := annotateMasterPlaylistCodecs(filepath.Join(OutputDirLLHLS, "master.m3u8"), renditions); err != nil {
+		log.Printf("Warning: failed to annotate LLHLS master playlist with codecs: %v", err)
+	}
+	// ffmpeg's own master.m3u8 points at the raw playlists it writes itself;
+	// repoint it at the real LL-HLS playlists llhlsManager owns instead.
+	if err := rewriteMasterPlaylistURIs(filepath.Join(OutputDirLLHLS, "master.m3u8"), "raw_stream_v", "stream_v"); err != nil {
+		log.Printf("Warning: failed to repoint LLHLS master playlist at native playlists: %v", err)
+	}
+
+	renditionNames := make([]string, len(renditions))
+	for i := range renditions {
+		renditionNames[i] = strconv.Itoa(i)
+	}
+	sm.llhlsMgr = newLLHLSManager(OutputDirLLHLS)
+	sm.llhlsMgr.Start(renditionNames, startNumberLLHLS, SegmentDurationLLHLS)
+
+	eventBus.Publish(EventFFmpegStarted, map[string]interface{}{"program": sm.currentProgram.Title, "source": source.Describe()})
+
 	return nil
 }
 
@@ -515,7 +816,7 @@ func (sm *StreamManager) monitorStreamHealth() {
 			continue
 		}
 
-		info, err := os.Stat(filepath.Join(OutputDirHLS, "stream.m3u8"))
+		info, err := os.Stat(filepath.Join(OutputDirHLS, "master.m3u8"))
 		if err != nil {
 			if os.IsNotExist(err) {
 				log.Printf("Warning: Stream running but playlist missing")
@@ -524,30 +825,125 @@ func (sm *StreamManager) monitorStreamHealth() {
 		}
 
 		if time.Since(info.ModTime()) > 30*time.Second {
+			eventBus.Publish(EventStreamStalled, map[string]interface{}{"stale_for_seconds": time.Since(info.ModTime()).Seconds()})
 			log.Fatalf("Stream stalled: playlist not updated in %v. Crashing to trigger restart.", time.Since(info.ModTime()))
 		}
 	}
 }
 
+// watchProgramBoundary chains the schedule: once the program ffmpeg was
+// launched with is no longer the one that should be airing, it restarts
+// ffmpeg on the new program. Segment numbering stays monotonic because
+// startFFmpeg derives start numbers from the broadcast clock, not from the
+// program itself.
+func (sm *StreamManager) watchProgramBoundary() {
+	ticker := time.NewTicker(2 * time.Second)
+	for range ticker.C {
+		sm.ffmpegMutex.Lock()
+		running := sm.isRunning
+		wasPlaying := sm.currentProgram
+		sm.ffmpegMutex.Unlock()
+
+		sm.sourceMutex.Lock()
+		seekable := sm.source == nil || sm.source.Seekable()
+		sm.sourceMutex.Unlock()
+
+		if !running || !seekable || scheduler == nil || len(scheduler.List().Entries) == 0 {
+			continue
+		}
+
+		prog, _, _, _ := sm.resolveProgram(sm.elapsedSinceGenesis())
+		if prog.File != wasPlaying.File || prog.Title != wasPlaying.Title {
+			log.Printf("Program boundary reached: %q -> %q, restarting ffmpeg", wasPlaying.Title, prog.Title)
+			eventBus.Publish(EventProgramChanged, map[string]interface{}{"from": wasPlaying.Title, "to": prog.Title})
+			sm.stopFFmpeg()
+			if err := sm.startFFmpeg(); err != nil {
+				log.Printf("Failed to start next program: %v", err)
+			}
+		}
+	}
+}
+
 func (sm *StreamManager) stopFFmpeg() {
 	sm.ffmpegMutex.Lock()
 	defer sm.ffmpegMutex.Unlock()
-	
+
 	if sm.ffmpegCmd != nil && sm.ffmpegCmd.Process != nil {
 		sm.ffmpegCmd.Process.Kill()
+		// Block until the process has actually exited, not just been sent a
+		// signal - a live source like RTMP listen mode holds its bound port
+		// until then, and starting the replacement ffmpeg too early fails
+		// to rebind it.
+		if sm.ffmpegExited != nil {
+			<-sm.ffmpegExited
+		}
 	}
 	sm.isRunning = false
+	if sm.llhlsMgr != nil {
+		sm.llhlsMgr.Stop()
+		sm.llhlsMgr = nil
+	}
+}
+
+// switchSource swaps in a new input and restarts ffmpeg onto it. If the
+// station was paused on a seekable source, a switch to a live source drops
+// the pause - there's nothing to resume back to on a live feed.
+func (sm *StreamManager) switchSource(src Source) {
+	sm.sourceMutex.Lock()
+	sm.source = src
+	sm.sourceMutex.Unlock()
+
+	if !src.Seekable() && sm.genesis.IsPaused {
+		sm.genesis.IsPaused = false
+		sm.genesis.PausedPosition = 0
+		sm.saveGenesis()
+	}
+
+	sm.stopFFmpeg()
+	if err := sm.startFFmpeg(); err != nil {
+		log.Printf("Failed to start ffmpeg on new source: %v", err)
+	}
+}
+
+func (sm *StreamManager) sourceDescription() string {
+	sm.sourceMutex.Lock()
+	defer sm.sourceMutex.Unlock()
+	if sm.source == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s:%s", sm.source.Name(), sm.source.Describe())
+}
+
+// sourceInfo returns the live source's identifying fields under sourceMutex,
+// for handlers that need more than one of them at a consistent snapshot.
+func (sm *StreamManager) sourceInfo() (name, desc string, seekable bool) {
+	sm.sourceMutex.Lock()
+	defer sm.sourceMutex.Unlock()
+	if sm.source == nil {
+		return "", "", false
+	}
+	return sm.source.Name(), sm.source.Describe(), sm.source.Seekable()
 }
 
-func (sm *StreamManager) pauseStream() {
+func (sm *StreamManager) pauseStream() error {
+	sm.sourceMutex.Lock()
+	seekable := sm.source == nil || sm.source.Seekable()
+	sm.sourceMutex.Unlock()
+	if !seekable {
+		return fmt.Errorf("current source is live and does not support pause")
+	}
+
 	sm.stopFFmpeg()
-	
+
 	// Calculate where we were
 	seekTime, _, _ := sm.calculateCurrentPosition()
-	
+
 	sm.genesis.IsPaused = true
 	sm.genesis.PausedPosition = seekTime
 	sm.saveGenesis()
+
+	eventBus.Publish(EventPaused, map[string]interface{}{"position": seekTime})
+	return nil
 }
 
 func (sm *StreamManager) resumeStream() {
@@ -555,18 +951,27 @@ func (sm *StreamManager) resumeStream() {
 	// CurrentTime = Now - StartTime
 	// We want CurrentTime = PausedPosition
 	// So StartTime = Now - PausedPosition
-	
+
 	sm.genesis.StartTime = time.Now().Unix() - int64(sm.genesis.PausedPosition)
 	sm.genesis.IsPaused = false
 	sm.saveGenesis()
-	
+
+	eventBus.Publish(EventResumed, map[string]interface{}{"position": sm.genesis.PausedPosition})
+
 	// Force start immediately
 	sm.startFFmpeg()
 }
 
-func (sm *StreamManager) seekStream(pos float64) {
+func (sm *StreamManager) seekStream(pos float64) error {
+	sm.sourceMutex.Lock()
+	seekable := sm.source == nil || sm.source.Seekable()
+	sm.sourceMutex.Unlock()
+	if !seekable {
+		return fmt.Errorf("current source is live and does not support seeking")
+	}
+
 	sm.stopFFmpeg()
-	
+
 	// Update StartTime so that current time matches pos
 	sm.genesis.StartTime = time.Now().Unix() - int64(pos)
 	sm.genesis.PausedPosition = pos // Update this just in case we stay paused?
@@ -579,10 +984,13 @@ func (sm *StreamManager) seekStream(pos float64) {
 		sm.genesis.StartTime = time.Now().Unix() - int64(pos)
 	}
 	sm.saveGenesis()
-	
+
+	eventBus.Publish(EventSought, map[string]interface{}{"position": pos})
+
 	if !sm.genesis.IsPaused {
 		sm.startFFmpeg()
 	}
+	return nil
 }
 
 func (sm *StreamManager) updateLastAccess() {
@@ -601,8 +1009,15 @@ func (sm *StreamManager) watchdog() {
 			log.Println("Idle timeout reached, stopping FFmpeg")
 			if sm.ffmpegCmd != nil && sm.ffmpegCmd.Process != nil {
 				sm.ffmpegCmd.Process.Kill()
+				if sm.ffmpegExited != nil {
+					<-sm.ffmpegExited
+				}
 			}
 			sm.isRunning = false
+			if sm.llhlsMgr != nil {
+				sm.llhlsMgr.Stop()
+				sm.llhlsMgr = nil
+			}
 		}
 		sm.ffmpegMutex.Unlock()
 	}
@@ -612,36 +1027,45 @@ func (sm *StreamManager) watchdog() {
 
 func (sm *StreamManager) trackViewer(ip string, streamType string) {
 	sm.viewersMutex.Lock()
-	defer sm.viewersMutex.Unlock()
-	
+
 	now := time.Now()
+	var isNew bool
 	if streamType == "hls" {
+		_, isNew = sm.viewersHLS[ip]
+		isNew = !isNew
 		sm.viewersHLS[ip] = now
 	} else if streamType == "llhls" {
+		_, isNew = sm.viewersLLHLS[ip]
+		isNew = !isNew
 		sm.viewersLLHLS[ip] = now
 	}
+	sm.viewersMutex.Unlock()
+
+	if isNew {
+		eventBus.Publish(EventViewerJoined, map[string]interface{}{"ip": ip, "protocol": streamType})
+	}
 }
 
 func (sm *StreamManager) getViewerStats() (hlsViewers []string, llhlsViewers []string) {
 	sm.viewersMutex.Lock()
 	defer sm.viewersMutex.Unlock()
-	
+
 	cutoff := time.Now().Add(-60 * time.Second)
-	
+
 	for ip, lastSeen := range sm.viewersHLS {
 		if lastSeen.After(cutoff) {
 			hlsViewers = append(hlsViewers, ip)
 		}
 	}
 	sort.Strings(hlsViewers)
-	
+
 	for ip, lastSeen := range sm.viewersLLHLS {
 		if lastSeen.After(cutoff) {
 			llhlsViewers = append(llhlsViewers, ip)
 		}
 	}
 	sort.Strings(llhlsViewers)
-	
+
 	return
 }
 
@@ -650,40 +1074,75 @@ func (sm *StreamManager) cleanupViewers() {
 		time.Sleep(10 * time.Second)
 		sm.viewersMutex.Lock()
 		cutoff := time.Now().Add(-60 * time.Second)
-		
+
+		var left []map[string]interface{}
 		for ip, lastSeen := range sm.viewersHLS {
 			if lastSeen.Before(cutoff) {
 				delete(sm.viewersHLS, ip)
+				left = append(left, map[string]interface{}{"ip": ip, "protocol": "hls"})
 			}
 		}
 		for ip, lastSeen := range sm.viewersLLHLS {
 			if lastSeen.Before(cutoff) {
 				delete(sm.viewersLLHLS, ip)
+				left = append(left, map[string]interface{}{"ip": ip, "protocol": "llhls"})
 			}
 		}
 		sm.viewersMutex.Unlock()
+
+		for _, data := range left {
+			eventBus.Publish(EventViewerLeft, data)
+		}
 	}
 }
 
 func (sm *StreamManager) getCurrentPlayingTime() string {
+	sm.sourceMutex.Lock()
+	seekable := sm.source == nil || sm.source.Seekable()
+	sm.sourceMutex.Unlock()
+	if !seekable {
+		return "--:--:--"
+	}
+
 	seekTime, _, _ := sm.calculateCurrentPosition()
-	
+
 	hours := int(seekTime / 3600)
 	minutes := int((seekTime - float64(hours*3600)) / 60)
 	seconds := int(seekTime - float64(hours*3600) - float64(minutes*60))
-	
+
 	return fmt.Sprintf("%02d:%02d:%02d", hours, minutes, seconds)
 }
 
 func (sm *StreamManager) getProgress() float64 {
-	seekTime, _, _ := sm.calculateCurrentPosition()
-	
-	if sm.videoDuration > 0 {
-		return (seekTime / sm.videoDuration) * 100
+	sm.sourceMutex.Lock()
+	seekable := sm.source == nil || sm.source.Seekable()
+	sm.sourceMutex.Unlock()
+	if !seekable {
+		return 0
+	}
+
+	prog, offset, _, _ := sm.resolveProgram(sm.elapsedSinceGenesis())
+
+	duration := prog.Duration
+	if duration <= 0 {
+		duration = sm.videoDuration
+	}
+	if duration > 0 {
+		return (offset / duration) * 100
 	}
 	return 0
 }
 
+// nextProgramTitle returns the title of the program due to air next, or ""
+// when there's no schedule (the legacy single-video loop has nothing to
+// announce).
+func (sm *StreamManager) nextProgramTitle() string {
+	if sm.nextProgram == nil {
+		return ""
+	}
+	return sm.nextProgram.Title
+}
+
 func (sm *StreamManager) getCPUSample() (idle, total uint64, err error) {
 	contents, err := os.ReadFile("/proc/stat")
 	if err != nil {
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Hand-rolled Prometheus text-exposition metrics. The binary is small enough
+// that pulling in client_golang felt like overkill - this covers the
+// counter/gauge/histogram shapes we actually need.
+
+var (
+	metricsFFmpegRestarts  uint64 // atomic
+	metricsPlaylistReloads labeledCounter
+	metricsSegmentBytes    labeledCounter
+	metricsSegmentDuration = newHistogram([]float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10})
+)
+
+// labeledCounter is a counter vector keyed by a pre-formatted label string,
+// e.g. `protocol="hls",rendition="0"`.
+type labeledCounter struct {
+	mu     sync.Mutex
+	values map[string]uint64
+}
+
+func (c *labeledCounter) Add(labels string, delta uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.values == nil {
+		c.values = make(map[string]uint64)
+	}
+	c.values[labels] += delta
+}
+
+func (c *labeledCounter) snapshot() map[string]uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make(map[string]uint64, len(c.values))
+	for k, v := range c.values {
+		out[k] = v
+	}
+	return out
+}
+
+// histogram is an unlabeled cumulative histogram with fixed bucket bounds.
+type histogram struct {
+	mu      sync.Mutex
+	bounds  []float64
+	counts  []uint64
+	sum     float64
+	total   uint64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) Observe(seconds float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.sum += seconds
+	h.total++
+	for i, bound := range h.bounds {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+}
+
+func (h *histogram) writeTo(b *strings.Builder, name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	fmt.Fprintf(b, "# TYPE %s histogram\n", name)
+	for i, bound := range h.bounds {
+		fmt.Fprintf(b, "%s_bucket{le=\"%g\"} %d\n", name, bound, h.counts[i])
+	}
+	fmt.Fprintf(b, "%s_bucket{le=\"+Inf\"} %d\n", name, h.total)
+	fmt.Fprintf(b, "%s_sum %g\n", name, h.sum)
+	fmt.Fprintf(b, "%s_count %d\n", name, h.total)
+}
+
+func writeLabeledCounter(b *strings.Builder, name, help string, c *labeledCounter) {
+	fmt.Fprintf(b, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(b, "# TYPE %s counter\n", name)
+	snapshot := c.snapshot()
+	keys := make([]string, 0, len(snapshot))
+	for k := range snapshot {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if k == "" {
+			fmt.Fprintf(b, "%s %d\n", name, snapshot[k])
+		} else {
+			fmt.Fprintf(b, "%s{%s} %d\n", name, k, snapshot[k])
+		}
+	}
+}
+
+// bytesCountingResponseWriter wraps an http.ResponseWriter to attribute
+// bytes written to a specific segment/playlist request.
+type bytesCountingResponseWriter struct {
+	http.ResponseWriter
+	bytesWritten int64
+}
+
+func (w *bytesCountingResponseWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.bytesWritten += int64(n)
+	return n, err
+}
+
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	var b strings.Builder
+
+	viewersHLS, viewersLLHLS := streamManager.getViewerStats()
+	fmt.Fprintf(&b, "# HELP vtv_viewers Current distinct viewers in the last 60s, by protocol.\n")
+	fmt.Fprintf(&b, "# TYPE vtv_viewers gauge\n")
+	fmt.Fprintf(&b, "vtv_viewers{protocol=\"hls\"} %d\n", len(viewersHLS))
+	fmt.Fprintf(&b, "vtv_viewers{protocol=\"llhls\"} %d\n", len(viewersLLHLS))
+
+	ffmpegUp := 0
+	if streamManager.isRunning {
+		ffmpegUp = 1
+	}
+	fmt.Fprintf(&b, "# HELP vtv_ffmpeg_up Whether the ffmpeg encode process is currently running.\n")
+	fmt.Fprintf(&b, "# TYPE vtv_ffmpeg_up gauge\n")
+	fmt.Fprintf(&b, "vtv_ffmpeg_up %d\n", ffmpegUp)
+
+	fmt.Fprintf(&b, "# HELP vtv_ffmpeg_restarts_total Number of times the ffmpeg process has been restarted, not counting its first start.\n")
+	fmt.Fprintf(&b, "# TYPE vtv_ffmpeg_restarts_total counter\n")
+	fmt.Fprintf(&b, "vtv_ffmpeg_restarts_total %d\n", atomic.LoadUint64(&metricsFFmpegRestarts))
+
+	writeLabeledCounter(&b, "vtv_segment_bytes_sent_total", "Bytes served per segment/playlist request, by protocol and rendition.", &metricsSegmentBytes)
+	writeLabeledCounter(&b, "vtv_playlist_reloads_total", "Playlist (.m3u8) requests served, by protocol.", &metricsPlaylistReloads)
+
+	metricsSegmentDuration.writeTo(&b, "vtv_segment_request_duration_seconds")
+
+	cpu := strings.TrimSuffix(streamManager.getCachedCPU(), "%")
+	fmt.Fprintf(&b, "# HELP vtv_cpu_usage_percent Host CPU utilization sampled from /proc/stat.\n")
+	fmt.Fprintf(&b, "# TYPE vtv_cpu_usage_percent gauge\n")
+	fmt.Fprintf(&b, "vtv_cpu_usage_percent %s\n", cpu)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprint(w, b.String())
+}
+
+// renditionLabelFromFilename pulls "0" out of "segment_v0_12.ts" /
+// "stream_v0.m3u8" / "init_v0.mp4" for the rendition metric label, or ""
+// for files that aren't rendition-specific (e.g. master.m3u8).
+func renditionLabelFromFilename(name string) string {
+	i := strings.Index(name, "_v")
+	if i < 0 {
+		return ""
+	}
+	rest := name[i+2:]
+	j := strings.IndexAny(rest, "_.")
+	if j < 0 {
+		return rest
+	}
+	return rest[:j]
+}
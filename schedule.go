@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Program is one playable item in the schedule: a slice of a source file.
+type Program struct {
+	File        string  `json:"file"`
+	Title       string  `json:"title"`
+	StartOffset float64 `json:"start_offset"`
+	Duration    float64 `json:"duration"`
+}
+
+// ScheduleEntry pins a Program to a time of day (HH:MM:SS, "24:00" wrapping)
+// within the station's repeating broadcast day, which starts at the
+// station's genesis time rather than real calendar midnight.
+type ScheduleEntry struct {
+	StartTime string  `json:"start_time"`
+	Program   Program `json:"program"`
+}
+
+// Schedule is the full EPG for one broadcast day. BumperFile fills any gap
+// between a program ending and the next one starting.
+type Schedule struct {
+	Entries    []ScheduleEntry `json:"entries"`
+	BumperFile string          `json:"bumper_file"`
+}
+
+// Scheduler guards the live Schedule against concurrent API edits and
+// ffmpeg-loop reads, mirroring how StreamManager guards viewer state.
+type Scheduler struct {
+	mu       sync.RWMutex
+	schedule Schedule
+	path     string
+}
+
+var scheduler *Scheduler
+
+func newScheduler(path string) *Scheduler {
+	return &Scheduler{path: path}
+}
+
+func (s *Scheduler) load() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			s.schedule = Schedule{}
+			return nil
+		}
+		return err
+	}
+
+	var sched Schedule
+	if err := json.Unmarshal(data, &sched); err != nil {
+		return err
+	}
+	sortScheduleEntries(sched.Entries)
+	s.schedule = sched
+	return nil
+}
+
+func (s *Scheduler) saveLocked() error {
+	data, err := json.MarshalIndent(s.schedule, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0644)
+}
+
+// List returns a copy of the current schedule.
+func (s *Scheduler) List() Schedule {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := s.schedule
+	out.Entries = append([]ScheduleEntry(nil), s.schedule.Entries...)
+	return out
+}
+
+// Add appends a program to the schedule and re-sorts by start time.
+func (s *Scheduler) Add(entry ScheduleEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.schedule.Entries = append(s.schedule.Entries, entry)
+	sortScheduleEntries(s.schedule.Entries)
+	return s.saveLocked()
+}
+
+// Remove deletes the entry starting at startTime.
+func (s *Scheduler) Remove(startTime string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := s.schedule.Entries[:0]
+	for _, e := range s.schedule.Entries {
+		if e.StartTime != startTime {
+			out = append(out, e)
+		}
+	}
+	s.schedule.Entries = out
+	return s.saveLocked()
+}
+
+// Reorder replaces the schedule with the given entries verbatim (after
+// re-sorting by start time), used by the EPG API to rearrange the day.
+func (s *Scheduler) Reorder(entries []ScheduleEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sortScheduleEntries(entries)
+	s.schedule.Entries = entries
+	return s.saveLocked()
+}
+
+func sortScheduleEntries(entries []ScheduleEntry) {
+	sort.Slice(entries, func(i, j int) bool {
+		si, _ := parseTimeOfDay(entries[i].StartTime)
+		sj, _ := parseTimeOfDay(entries[j].StartTime)
+		return si < sj
+	})
+}
+
+// parseTimeOfDay parses "HH:MM:SS" into seconds since broadcast-day start.
+func parseTimeOfDay(s string) (float64, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("expected HH:MM:SS, got %q", s)
+	}
+	h, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, err
+	}
+	m, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, err
+	}
+	sec, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return 0, err
+	}
+	return float64(h*3600 + m*60 + sec), nil
+}
+
+const broadcastDaySeconds = 86400
+
+// Resolve maps `elapsed` seconds since genesis onto the repeating broadcast
+// day and returns the active program (or a bumper, if elapsed falls in a
+// gap), how far into that program we are, and the next program due to air.
+func (s *Scheduler) Resolve(elapsed float64) (prog Program, offset float64, isBumper bool, next *Program) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if len(s.schedule.Entries) == 0 {
+		return Program{}, 0, false, nil
+	}
+
+	tod := math.Mod(elapsed, broadcastDaySeconds)
+	if tod < 0 {
+		tod += broadcastDaySeconds
+	}
+
+	entries := s.schedule.Entries // already sorted by start time
+
+	for i, e := range entries {
+		start, err := parseTimeOfDay(e.StartTime)
+		if err != nil {
+			continue
+		}
+		end := start + e.Program.Duration
+		if tod >= start && tod < end {
+			var n *Program
+			if i+1 < len(entries) {
+				n = &entries[i+1].Program
+			} else {
+				n = &entries[0].Program
+			}
+			return e.Program, tod - start, false, n
+		}
+	}
+
+	// A program that crosses midnight (start+duration > broadcastDaySeconds)
+	// is still on air for the portion of tod that falls before its start but
+	// within its wrapped overrun - e.g. a 23:00 program with a 3h duration
+	// is still playing at 01:00. The loop above only matched the pre-midnight
+	// window, so check the wrapped window of the last entry explicitly.
+	lastEntry := entries[len(entries)-1]
+	if start, err := parseTimeOfDay(lastEntry.StartTime); err == nil {
+		end := start + lastEntry.Program.Duration
+		if wrappedEnd := end - broadcastDaySeconds; end > broadcastDaySeconds && tod < wrappedEnd {
+			return lastEntry.Program, tod + (broadcastDaySeconds - start), false, &entries[0].Program
+		}
+	}
+
+	// Gap: find the entry we're waiting on and fill with the bumper.
+	for i, e := range entries {
+		start, err := parseTimeOfDay(e.StartTime)
+		if err != nil || tod >= start {
+			continue
+		}
+		var gapStart float64
+		if i == 0 {
+			lastStart, _ := parseTimeOfDay(entries[len(entries)-1].StartTime)
+			lastEnd := lastStart + entries[len(entries)-1].Program.Duration
+			if lastEnd >= broadcastDaySeconds {
+				gapStart = lastEnd - broadcastDaySeconds
+			}
+		} else {
+			prevStart, _ := parseTimeOfDay(entries[i-1].StartTime)
+			gapStart = prevStart + entries[i-1].Program.Duration
+		}
+		bumper := Program{File: s.schedule.BumperFile, Title: "Bumper", Duration: start - gapStart}
+		return bumper, tod - gapStart, true, &e.Program
+	}
+
+	// Past the last entry, before it wraps at midnight: bumper until wrap.
+	last := entries[len(entries)-1]
+	lastStart, _ := parseTimeOfDay(last.StartTime)
+	gapStart := lastStart + last.Program.Duration
+	bumper := Program{File: s.schedule.BumperFile, Title: "Bumper", Duration: broadcastDaySeconds - gapStart}
+	return bumper, tod - gapStart, true, &entries[0].Program
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// Source abstracts where ffmpeg reads its input from. A FileSource is the
+// only one with a seekable timeline - it's what lets
+// the station have pause/seek/schedule semantics at all. The live ingest
+// sources (RTMP listen, RTSP/SRT/HLS pull) run in "virtual live" passthrough
+// instead: no seeking, no looping, no schedule.
+type Source interface {
+	// FFmpegInputArgs returns the args ffmpeg needs before its first output
+	// group to read this source, seeked to the given offset. Non-seekable
+	// sources ignore seek.
+	FFmpegInputArgs(seek float64) []string
+	// Duration reports the source's total length, if known. Live sources
+	// report ok=false.
+	Duration() (float64, bool)
+	// Seekable reports whether pause/seek/resume and the program scheduler
+	// apply to this source.
+	Seekable() bool
+	// Name identifies the source kind for the dashboard/API, e.g. "file".
+	Name() string
+	// Describe returns the input path/URL for display.
+	Describe() string
+}
+
+// FileSource reads a local, seekable media file - the original (and still
+// default) virtual-live-loop input. Duration reports a length only when the
+// duration field has been set; newSource leaves it unset, so a FileSource
+// built there reports ok=false.
+type FileSource struct {
+	Path     string
+	duration float64
+}
+
+func (s *FileSource) FFmpegInputArgs(seek float64) []string {
+	return []string{"-re", "-ss", fmt.Sprintf("%.2f", seek), "-i", s.Path}
+}
+
+func (s *FileSource) Duration() (float64, bool) {
+	return s.duration, s.duration > 0
+}
+
+func (s *FileSource) Seekable() bool   { return true }
+func (s *FileSource) Name() string     { return "file" }
+func (s *FileSource) Describe() string { return s.Path }
+
+// RTMPSource waits for an incoming RTMP publish (e.g. from OBS) - the
+// station is the RTMP server here, not a client pulling from one, so ffmpeg
+// needs -listen 1 and a server-style rtmp://<bind>:<port>/<app>/<key> URL to
+// bind rather than connect to.
+type RTMPSource struct {
+	ListenAddr string
+}
+
+func (s *RTMPSource) FFmpegInputArgs(seek float64) []string {
+	return []string{"-listen", "1", "-i", s.ListenAddr}
+}
+
+func (s *RTMPSource) Duration() (float64, bool) { return 0, false }
+func (s *RTMPSource) Seekable() bool            { return false }
+func (s *RTMPSource) Name() string              { return "rtmp" }
+func (s *RTMPSource) Describe() string          { return s.ListenAddr }
+
+// RTSPSource pulls a live RTSP feed (e.g. an IP camera). Forcing TCP avoids
+// the UDP packet loss/reordering that otherwise shows up as corrupt frames.
+type RTSPSource struct {
+	URL string
+}
+
+func (s *RTSPSource) FFmpegInputArgs(seek float64) []string {
+	return []string{"-rtsp_transport", "tcp", "-i", s.URL}
+}
+
+func (s *RTSPSource) Duration() (float64, bool) { return 0, false }
+func (s *RTSPSource) Seekable() bool            { return false }
+func (s *RTSPSource) Name() string              { return "rtsp" }
+func (s *RTSPSource) Describe() string          { return s.URL }
+
+// SRTSource pulls a live SRT feed. The URL carries its own srt:// scheme and
+// any mode/latency query params, so ffmpeg needs nothing beyond -i.
+type SRTSource struct {
+	URL string
+}
+
+func (s *SRTSource) FFmpegInputArgs(seek float64) []string {
+	return []string{"-i", s.URL}
+}
+
+func (s *SRTSource) Duration() (float64, bool) { return 0, false }
+func (s *SRTSource) Seekable() bool            { return false }
+func (s *SRTSource) Name() string              { return "srt" }
+func (s *SRTSource) Describe() string          { return s.URL }
+
+// HLSPullSource pulls an upstream HLS stream and re-packages it. We always
+// start at the live edge - there's no local copy of earlier segments to
+// seek back into.
+type HLSPullSource struct {
+	URL string
+}
+
+func (s *HLSPullSource) FFmpegInputArgs(seek float64) []string {
+	return []string{"-live_start_index", "-1", "-i", s.URL}
+}
+
+func (s *HLSPullSource) Duration() (float64, bool) { return 0, false }
+func (s *HLSPullSource) Seekable() bool            { return false }
+func (s *HLSPullSource) Name() string              { return "hls" }
+func (s *HLSPullSource) Describe() string          { return s.URL }
+
+// newSource builds a Source from a kind/url pair, as accepted by /api/source
+// and the SOURCE_TYPE/SOURCE_URL env vars. kind "" or "file" with an empty
+// url falls back to the configured VideoPath; any other url is resolved
+// against MediaDir, and rtsp/srt/hls urls are checked against
+// AllowedSourceHosts, since both are reachable at runtime over the network
+// and not just at startup like VideoPath/SOURCE_URL are.
+func newSource(kind, rawurl string) (Source, error) {
+	switch kind {
+	case "", "file":
+		if rawurl == "" {
+			return &FileSource{Path: VideoPath}, nil
+		}
+		path, err := resolveMediaPath(rawurl)
+		if err != nil {
+			return nil, err
+		}
+		return &FileSource{Path: path}, nil
+	case "rtmp":
+		// The station listens for the publish rather than connecting out, so
+		// unlike the other live sources an explicit url isn't required - it
+		// defaults to binding RTMPListenPort on every interface.
+		addr := rawurl
+		if addr == "" {
+			addr = fmt.Sprintf("rtmp://:%d/live/stream", RTMPListenPort)
+		}
+		return &RTMPSource{ListenAddr: addr}, nil
+	case "rtsp":
+		if rawurl == "" {
+			return nil, fmt.Errorf("rtsp source requires a url")
+		}
+		if err := hostAllowed(rawurl); err != nil {
+			return nil, err
+		}
+		return &RTSPSource{URL: rawurl}, nil
+	case "srt":
+		if rawurl == "" {
+			return nil, fmt.Errorf("srt source requires a url")
+		}
+		if err := hostAllowed(rawurl); err != nil {
+			return nil, err
+		}
+		return &SRTSource{URL: rawurl}, nil
+	case "hls":
+		if rawurl == "" {
+			return nil, fmt.Errorf("hls source requires a url")
+		}
+		if err := hostAllowed(rawurl); err != nil {
+			return nil, err
+		}
+		return &HLSPullSource{URL: rawurl}, nil
+	default:
+		return nil, fmt.Errorf("unknown source type %q", kind)
+	}
+}
+
+// resolveMediaPath confines a caller-supplied file source path to MediaDir,
+// rejecting absolute paths and any "../" that would escape it. Without this,
+// /api/source's file type would let a caller point ffmpeg (and therefore the
+// public HLS/LLHLS output) at any file on disk it can read.
+func resolveMediaPath(path string) (string, error) {
+	if filepath.IsAbs(path) {
+		return "", fmt.Errorf("file source path must be relative to the media directory")
+	}
+	full := filepath.Join(MediaDir, path)
+	rel, err := filepath.Rel(MediaDir, full)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("file source path escapes the media directory")
+	}
+	return full, nil
+}
+
+// hostAllowed checks a live source's url against AllowedSourceHosts. Unlike
+// FileSource, rtsp/srt/hls sources have ffmpeg fetch from wherever the url
+// points, so an unrestricted url is a runtime SSRF primitive; the allowlist
+// is empty (nothing permitted) until an operator opts in via
+// ALLOWED_SOURCE_HOSTS.
+func hostAllowed(rawurl string) error {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return fmt.Errorf("invalid url: %v", err)
+	}
+	for _, host := range AllowedSourceHosts {
+		if strings.EqualFold(u.Hostname(), host) {
+			return nil
+		}
+	}
+	return fmt.Errorf("host %q is not in ALLOWED_SOURCE_HOSTS", u.Hostname())
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"log"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Hot-reload of genesis.json/config.json/schedule.json. We watch the
+// directory rather than the individual files since editors commonly save by
+// renaming a temp file over the target, which a file-level watch wouldn't
+// survive.
+const configWatchDebounce = 200 * time.Millisecond
+
+// watchConfigFiles runs for the lifetime of the process, reloading whichever
+// of genesis.json/config.json/schedule.json changed on disk. Most changes
+// take effect without restarting ffmpeg; encoder-affecting config changes
+// and a new genesis time fall back to a restart that preserves segment
+// numbering continuity (see restartFFmpegPreservingContinuity).
+func watchConfigFiles(sm *StreamManager) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		log.Printf("Hot-reload disabled: failed to start watcher: %v", err)
+		return
+	}
+	defer watcher.Close()
+
+	if err := watcher.Add("."); err != nil {
+		log.Printf("Hot-reload disabled: failed to watch working directory: %v", err)
+		return
+	}
+
+	var mu sync.Mutex
+	timers := make(map[string]*time.Timer)
+
+	for {
+		select {
+		case evt, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			name := filepath.Base(evt.Name)
+			if name != "config.json" && name != "schedule.json" && name != "genesis.json" {
+				continue
+			}
+
+			mu.Lock()
+			if t, pending := timers[name]; pending {
+				t.Stop()
+			}
+			timers[name] = time.AfterFunc(configWatchDebounce, func() {
+				handleConfigFileChange(sm, name)
+			})
+			mu.Unlock()
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("Hot-reload watcher error: %v", err)
+		}
+	}
+}
+
+// handleConfigFileChange reloads the file that changed and decides whether
+// the running ffmpeg process needs to restart to pick it up.
+func handleConfigFileChange(sm *StreamManager, name string) {
+	switch name {
+	case "config.json":
+		oldRenditions := appConfig.Renditions
+		if err := loadConfig(); err != nil {
+			log.Printf("Hot-reload: failed to reload config.json: %v", err)
+			return
+		}
+		if renditionsEqual(oldRenditions, appConfig.Renditions) {
+			log.Printf("Hot-reload: config.json changed, applying overlay template live")
+			sm.refreshOverlay()
+			return
+		}
+		log.Printf("Hot-reload: rendition ladder changed, restarting ffmpeg")
+		restartFFmpegPreservingContinuity(sm)
+
+	case "schedule.json":
+		if err := scheduler.load(); err != nil {
+			log.Printf("Hot-reload: failed to reload schedule.json: %v", err)
+			return
+		}
+		log.Printf("Hot-reload: schedule.json reloaded")
+
+	case "genesis.json":
+		oldGenesis := *sm.genesis
+		if err := sm.loadGenesis(); err != nil {
+			log.Printf("Hot-reload: failed to reload genesis.json: %v", err)
+			return
+		}
+		if reflect.DeepEqual(oldGenesis, *sm.genesis) {
+			// Our own resumeStream/seekStream/pauseStream already update
+			// genesis.json and restart ffmpeg themselves; this fires ~200ms
+			// later on that same self-write and would otherwise trigger a
+			// second, unnecessary restart.
+			return
+		}
+		log.Printf("Hot-reload: genesis.json reloaded, restarting ffmpeg")
+		restartFFmpegPreservingContinuity(sm)
+	}
+}
+
+// restartFFmpegPreservingContinuity restarts ffmpeg only if it's already
+// running. Segment numbering derives from elapsed-since-genesis time rather
+// than anything ffmpeg remembers internally, so viewers see no gap or
+// renumbering across the restart.
+func restartFFmpegPreservingContinuity(sm *StreamManager) {
+	sm.ffmpegMutex.Lock()
+	running := sm.isRunning
+	sm.ffmpegMutex.Unlock()
+	if !running {
+		return
+	}
+
+	sm.stopFFmpeg()
+	if err := sm.startFFmpeg(); err != nil {
+		log.Printf("Hot-reload: failed to restart ffmpeg: %v", err)
+	}
+}
+
+func renditionsEqual(a, b []RenditionConfig) bool {
+	return reflect.DeepEqual(a, b)
+}